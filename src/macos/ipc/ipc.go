@@ -0,0 +1,240 @@
+// Package ipc defines the typed request/response contract shared between the
+// rocketman manager (unprivileged, user-facing) and the rocketman tunnel
+// (privileged, runs sing-box) and the helpers used to dial and authorize the
+// Unix domain socket that connects them.
+package ipc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SocketPath is where the tunnel binary listens for manager connections.
+const SocketPath = "/var/run/com.rocketman.tunnel.sock"
+
+// ServiceName is the net/rpc service name the tunnel registers under, so
+// calls are addressed as e.g. "Tunnel.Start".
+const ServiceName = "Tunnel"
+
+// DialTimeout bounds how long the manager waits for the tunnel socket to
+// accept a connection, e.g. while the tunnel is still starting up.
+const DialTimeout = 2 * time.Second
+
+// StartRequest asks the tunnel to start the named tunnel (as defined in its
+// config file).
+type StartRequest struct {
+	Name string
+}
+
+// StartResponse reports the outcome of a Start call.
+type StartResponse struct {
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Message     string `json:"message"`
+	PID         int    `json:"pid"`
+	SingboxPath string `json:"singbox_path"`
+	ConfigPath  string `json:"config_path"`
+}
+
+// StopRequest asks the tunnel to stop the named tunnel's sing-box process.
+type StopRequest struct {
+	Name string
+}
+
+// StopResponse reports the outcome of a Stop call.
+type StopResponse struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// StatusRequest asks the tunnel for the named tunnel's current state.
+type StatusRequest struct {
+	Name string
+}
+
+// ListTunnelsRequest asks the tunnel for the status of every configured
+// tunnel.
+type ListTunnelsRequest struct{}
+
+// ListTunnelsResponse carries one StatusResponse per configured tunnel.
+type ListTunnelsResponse struct {
+	Tunnels []StatusResponse
+}
+
+// State is the supervisor state of the sing-box process, modeled on
+// supervisord's start -> running -> backoff -> fatal state machine.
+type State string
+
+const (
+	StateStopped  State = "stopped"
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	StateBackoff  State = "backoff"
+	StateFatal    State = "fatal"
+	StateExited   State = "exited"
+)
+
+// StatusResponse mirrors a single TunnelManager's current state.
+type StatusResponse struct {
+	Name         string    `json:"name"`
+	Status       string    `json:"status"`
+	State        State     `json:"state"`
+	PID          int       `json:"pid"`
+	SingboxPath  string    `json:"singbox_path"`
+	ConfigPath   string    `json:"config_path"`
+	LastExitCode int       `json:"last_exit_code"`
+	LastExitTime time.Time `json:"last_exit_time"`
+	Restarts     int       `json:"restarts"`
+}
+
+// EventType distinguishes the kinds of events SubscribeEvents can deliver.
+type EventType string
+
+const (
+	EventStateChanged EventType = "state_changed"
+	EventAppFailure   EventType = "app_failure"
+	EventAppReconnect EventType = "app_reconnect"
+)
+
+// Event is a single state-change or monitor notification.
+type Event struct {
+	Type    EventType `json:"type"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// SubscribeEventsRequest long-polls for the named tunnel's events after
+// Cursor. Cursor is 0 on the first call; the tunnel echoes back the new
+// cursor on every response so the caller can keep resuming from where it
+// left off.
+type SubscribeEventsRequest struct {
+	Name   string
+	Cursor int64
+}
+
+// SubscribeEventsResponse carries any events that arrived after Cursor. The
+// call blocks (up to a server-side timeout) until at least one event is
+// available or the timeout elapses, so callers should loop on it rather than
+// polling on a short interval.
+type SubscribeEventsResponse struct {
+	Events     []Event
+	NextCursor int64
+}
+
+// LogLine is a single line of sing-box stdout/stderr output.
+type LogLine struct {
+	Stream string    `json:"stream"` // "stdout" or "stderr"
+	Text   string    `json:"text"`
+	Time   time.Time `json:"time"`
+}
+
+// SubscribeLogsRequest long-polls for the named tunnel's log lines after
+// Cursor, the same way SubscribeEventsRequest does for events.
+type SubscribeLogsRequest struct {
+	Name   string
+	Cursor int64
+}
+
+// SubscribeLogsResponse carries any log lines that arrived after Cursor.
+type SubscribeLogsResponse struct {
+	Lines      []LogLine
+	NextCursor int64
+}
+
+// TunnelConfig describes one sing-box instance the tunnel should supervise.
+type TunnelConfig struct {
+	Name         string `yaml:"name" json:"name"`
+	SingboxPath  string `yaml:"singbox_path" json:"singbox_path"`
+	ConfigPath   string `yaml:"config_path" json:"config_path"`
+	Autostart    bool   `yaml:"autostart" json:"autostart"`
+	StartRetries int    `yaml:"start_retries" json:"start_retries"`
+	PingURL      string `yaml:"ping_url" json:"ping_url"`
+}
+
+// Config is the top-level shape of the -config file passed to both the
+// tunnel and the manager.
+type Config struct {
+	Tunnels []TunnelConfig `yaml:"tunnels" json:"tunnels"`
+}
+
+// LoadConfig reads and parses a tunnel config file, choosing YAML or JSON
+// based on the file extension (.json is parsed as JSON, everything else as
+// YAML).
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	var cfg Config
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("parse config as JSON: %w", err)
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("parse config as YAML: %w", err)
+		}
+	}
+
+	for i := range cfg.Tunnels {
+		if cfg.Tunnels[i].Name == "" {
+			return nil, fmt.Errorf("tunnel at index %d is missing a name", i)
+		}
+	}
+
+	return &cfg, nil
+}
+
+// ConfigReader re-reads a config file only when its mtime has advanced,
+// so callers can cheaply poll it (e.g. on SIGHUP) without re-parsing on
+// every call.
+type ConfigReader struct {
+	path    string
+	modTime time.Time
+}
+
+// NewConfigReader creates a reader for the config file at path.
+func NewConfigReader(path string) *ConfigReader {
+	return &ConfigReader{path: path}
+}
+
+// ReadIfChanged returns the parsed config and true if path's mtime has
+// advanced since the last successful read, or (nil, false, nil) if it
+// hasn't changed.
+func (cr *ConfigReader) ReadIfChanged() (*Config, bool, error) {
+	info, err := os.Stat(cr.path)
+	if err != nil {
+		return nil, false, fmt.Errorf("stat config: %w", err)
+	}
+
+	if !info.ModTime().After(cr.modTime) {
+		return nil, false, nil
+	}
+
+	cfg, err := LoadConfig(cr.path)
+	if err != nil {
+		return nil, false, err
+	}
+	cr.modTime = info.ModTime()
+
+	return cfg, true, nil
+}
+
+// Dial connects to the tunnel's Unix domain socket and returns an RPC client
+// speaking gob over it.
+func Dial() (*rpc.Client, error) {
+	conn, err := net.DialTimeout("unix", SocketPath, DialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("dial tunnel socket: %w", err)
+	}
+	return rpc.NewClient(conn), nil
+}
@@ -0,0 +1,33 @@
+package ipc
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// PeerUID returns the UID of the process on the other end of a freshly
+// accepted Unix domain socket connection, via LOCAL_PEERCRED (there is no
+// getpeereid(2) wrapper in x/sys/unix; this is the equivalent raw
+// getsockopt used on Darwin/BSD).
+func PeerUID(conn *net.UnixConn) (uint32, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, fmt.Errorf("syscall conn: %w", err)
+	}
+
+	var cred *unix.Xucred
+	var peerErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, peerErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if peerErr != nil {
+		return 0, fmt.Errorf("getsockopt LOCAL_PEERCRED: %w", peerErr)
+	}
+
+	return cred.Uid, nil
+}
@@ -0,0 +1,32 @@
+package ipc
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// PeerUID returns the UID of the process on the other end of a freshly
+// accepted Unix domain socket connection, via SO_PEERCRED (the Linux
+// equivalent of the LOCAL_PEERCRED getsockopt used on Darwin/BSD).
+func PeerUID(conn *net.UnixConn) (uint32, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, fmt.Errorf("syscall conn: %w", err)
+	}
+
+	var cred *unix.Ucred
+	var peerErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, peerErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if peerErr != nil {
+		return 0, fmt.Errorf("getsockopt SO_PEERCRED: %w", peerErr)
+	}
+
+	return cred.Uid, nil
+}
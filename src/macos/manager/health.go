@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthRequest is POSTed by AppMonitor to the main app's /health endpoint.
+type HealthRequest struct {
+	Nonce string    `json:"nonce"`
+	Ts    time.Time `json:"ts"`
+}
+
+// HealthResponse is the app's reply. It echoes Nonce/Ts back so AppMonitor
+// can verify the round trip and measure RTT, and reports the app's own view
+// of whether it still needs the tunnel.
+type HealthResponse struct {
+	Nonce              string    `json:"nonce"`
+	Ts                 time.Time `json:"ts"`
+	TunnelExpected     bool      `json:"tunnel_expected"`
+	WantsTunnelStopped bool      `json:"wants_tunnel_stopped"`
+}
+
+// checkHealth POSTs a health request to pingURL and returns the app's
+// response along with the measured round-trip time.
+func checkHealth(pingURL string) (HealthResponse, time.Duration, error) {
+	nonce, err := randomNonce()
+	if err != nil {
+		return HealthResponse{}, 0, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	req := HealthRequest{Nonce: nonce, Ts: time.Now()}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return HealthResponse{}, 0, fmt.Errorf("marshal health request: %w", err)
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	sentAt := time.Now()
+
+	httpResp, err := client.Post(pingURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return HealthResponse{}, 0, err
+	}
+	defer httpResp.Body.Close()
+
+	rtt := time.Since(sentAt)
+
+	if httpResp.StatusCode != http.StatusOK {
+		return HealthResponse{}, rtt, fmt.Errorf("health check returned status %d", httpResp.StatusCode)
+	}
+
+	var resp HealthResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return HealthResponse{}, rtt, fmt.Errorf("decode health response: %w", err)
+	}
+	if resp.Nonce != req.Nonce {
+		return HealthResponse{}, rtt, fmt.Errorf("health response nonce mismatch")
+	}
+
+	return resp, rtt, nil
+}
+
+func randomNonce() (string, error) {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
+
+// maxRTTSamples bounds how many recent health-check round trips are kept
+// for display at /status.
+const maxRTTSamples = 20
+
+// rttSample is one recorded health check round-trip.
+type rttSample struct {
+	Time time.Time     `json:"time"`
+	RTT  time.Duration `json:"rtt"`
+}
+
+// HealthSnapshot is the read-only view of a healthHistory exposed at
+// /status.
+type HealthSnapshot struct {
+	LastSeen time.Time   `json:"last_seen"`
+	Samples  []rttSample `json:"rtt_samples"`
+}
+
+// healthHistory tracks a single tunnel's recent health-check RTTs and the
+// last time its app answered successfully. Safe for concurrent use by the
+// AppMonitor goroutine that records samples and the HTTP handler goroutines
+// that read them for /status.
+type healthHistory struct {
+	mu       sync.Mutex
+	samples  []rttSample
+	lastSeen time.Time
+}
+
+func newHealthHistory() *healthHistory {
+	return &healthHistory{}
+}
+
+func (h *healthHistory) record(sample rttSample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.samples = append(h.samples, sample)
+	if len(h.samples) > maxRTTSamples {
+		h.samples = h.samples[len(h.samples)-maxRTTSamples:]
+	}
+	h.lastSeen = sample.Time
+}
+
+func (h *healthHistory) snapshot() HealthSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples := make([]rttSample, len(h.samples))
+	copy(samples, h.samples)
+	return HealthSnapshot{LastSeen: h.lastSeen, Samples: samples}
+}
@@ -0,0 +1,745 @@
+// Command manager is the unprivileged half of the RocketMan service. It
+// exposes the HTTP control surface used by the main app and forwards every
+// tunnel operation to the privileged tunnel binary over the IPC socket
+// defined in package ipc.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/RocketMan-System/rocketman-service/src/macos/ipc"
+)
+
+// outboxSize bounds how many unsent frames a single WebSocket client can
+// have queued. eventHub subscriber channels of this size drop events once
+// full; the /logs and /events pollers instead wait for room in the outbox
+// before fetching more from the tunnel.
+const outboxSize = 64
+
+// Configuration
+const (
+	HTTP_PORT          = 5020
+	APP_CHECK_INTERVAL = 2 * time.Second
+	// defaultTunnelName is what the legacy /start, /stop, /status, /logs and
+	// /events routes operate on, for backward compatibility with clients
+	// that predate multi-tunnel config files.
+	defaultTunnelName = "default"
+)
+
+// TunnelClient is a thin RPC client wrapper around the tunnel's IPC socket.
+// It redials on demand so the manager tolerates the tunnel restarting.
+type TunnelClient struct{}
+
+func (c *TunnelClient) call(method string, args, reply interface{}) error {
+	client, err := ipc.Dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.Call(ipc.ServiceName+"."+method, args, reply)
+}
+
+func (c *TunnelClient) Start(name string) (ipc.StartResponse, error) {
+	var resp ipc.StartResponse
+	err := c.call("Start", ipc.StartRequest{Name: name}, &resp)
+	return resp, err
+}
+
+func (c *TunnelClient) Stop(name string) (ipc.StopResponse, error) {
+	var resp ipc.StopResponse
+	err := c.call("Stop", ipc.StopRequest{Name: name}, &resp)
+	return resp, err
+}
+
+func (c *TunnelClient) Status(name string) (ipc.StatusResponse, error) {
+	var resp ipc.StatusResponse
+	err := c.call("Status", ipc.StatusRequest{Name: name}, &resp)
+	return resp, err
+}
+
+func (c *TunnelClient) List() (ipc.ListTunnelsResponse, error) {
+	var resp ipc.ListTunnelsResponse
+	err := c.call("ListTunnels", ipc.ListTunnelsRequest{}, &resp)
+	return resp, err
+}
+
+func (c *TunnelClient) SubscribeEvents(name string, cursor int64) (ipc.SubscribeEventsResponse, error) {
+	var resp ipc.SubscribeEventsResponse
+	err := c.call("SubscribeEvents", ipc.SubscribeEventsRequest{Name: name, Cursor: cursor}, &resp)
+	return resp, err
+}
+
+func (c *TunnelClient) SubscribeLogs(name string, cursor int64) (ipc.SubscribeLogsResponse, error) {
+	var resp ipc.SubscribeLogsResponse
+	err := c.call("SubscribeLogs", ipc.SubscribeLogsRequest{Name: name, Cursor: cursor}, &resp)
+	return resp, err
+}
+
+// eventHub fans out one tunnel's locally-generated events (its AppMonitor's
+// failures and reconnects) to every subscribed /events WebSocket connection
+// for that tunnel. Tunnel state-change events reach the same connections
+// separately, by polling TunnelClient.SubscribeEvents.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan ipc.Event]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[chan ipc.Event]struct{})}
+}
+
+func (h *eventHub) publish(evt ipc.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- evt:
+		default:
+			// Slow consumer; drop the event rather than block the publisher.
+		}
+	}
+}
+
+func (h *eventHub) subscribe() chan ipc.Event {
+	ch := make(chan ipc.Event, outboxSize)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan ipc.Event) {
+	h.mu.Lock()
+	delete(h.subscribers, ch)
+	h.mu.Unlock()
+}
+
+// AppMonitor monitors the main application's liveness for one tunnel via
+// the bidirectional health protocol (see health.go) and stops that tunnel
+// if the app disappears or asks to be disconnected. It stops the tunnel
+// once maxFailures failed checks have accumulated, and only clears that
+// failure count after minSuccesses consecutive successful checks — a
+// single lucky check between failures doesn't reset it, so a flapping
+// connection still counts toward the limit.
+type AppMonitor struct {
+	tunnel              *TunnelClient
+	events              *eventHub
+	health              *healthHistory
+	tunnelName          string
+	pingURL             string
+	checkInterval       time.Duration
+	maxFailures         int
+	minSuccesses        int
+	consecutiveFailures int
+	consecutiveSuccess  int
+	stopChan            chan struct{}
+	done                chan struct{}
+}
+
+// NewAppMonitor creates a new app monitor for the named tunnel.
+func NewAppMonitor(tunnel *TunnelClient, events *eventHub, tunnelName, pingURL string, checkInterval time.Duration) *AppMonitor {
+	return &AppMonitor{
+		tunnel:        tunnel,
+		events:        events,
+		health:        newHealthHistory(),
+		tunnelName:    tunnelName,
+		pingURL:       pingURL,
+		checkInterval: checkInterval,
+		maxFailures:   3,
+		minSuccesses:  2,
+		stopChan:      make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// Start starts monitoring.
+func (am *AppMonitor) Start() {
+	go am.monitorLoop()
+	log.Printf("App monitor started for tunnel %q", am.tunnelName)
+}
+
+// Stop stops monitoring.
+func (am *AppMonitor) Stop() {
+	close(am.stopChan)
+	<-am.done
+	log.Printf("App monitor stopped for tunnel %q", am.tunnelName)
+}
+
+// monitorLoop is the main monitoring loop.
+func (am *AppMonitor) monitorLoop() {
+	defer close(am.done)
+
+	ticker := time.NewTicker(am.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-am.stopChan:
+			return
+		case <-ticker.C:
+			status, err := am.tunnel.Status(am.tunnelName)
+			if err != nil || status.Status != "running" {
+				continue
+			}
+
+			resp, rtt, err := checkHealth(am.pingURL)
+			if err != nil {
+				am.recordFailure()
+				continue
+			}
+			am.health.record(rttSample{Time: time.Now(), RTT: rtt})
+
+			if resp.WantsTunnelStopped {
+				log.Printf("App requested graceful stop of tunnel %q", am.tunnelName)
+				am.stopTunnel("app requested graceful stop")
+				am.consecutiveFailures = 0
+				am.consecutiveSuccess = 0
+				continue
+			}
+
+			am.recordSuccess()
+		}
+	}
+}
+
+// recordSuccess clears the failure counter once minSuccesses consecutive
+// successful checks have followed a failure streak.
+func (am *AppMonitor) recordSuccess() {
+	if am.consecutiveFailures == 0 {
+		return
+	}
+
+	am.consecutiveSuccess++
+	if am.consecutiveSuccess < am.minSuccesses {
+		return
+	}
+
+	log.Printf("Main app reconnected for tunnel %q", am.tunnelName)
+	am.events.publish(ipc.Event{
+		Type:    ipc.EventAppReconnect,
+		Message: fmt.Sprintf("main app reconnected for tunnel %q", am.tunnelName),
+		Time:    time.Now(),
+	})
+	am.consecutiveFailures = 0
+	am.consecutiveSuccess = 0
+}
+
+// recordFailure accumulates failures (not cleared until recordSuccess has
+// seen minSuccesses in a row) and stops the tunnel once maxFailures is
+// reached.
+func (am *AppMonitor) recordFailure() {
+	am.consecutiveSuccess = 0
+	am.consecutiveFailures++
+
+	if am.consecutiveFailures < am.maxFailures {
+		return
+	}
+
+	log.Printf("Main app not responding for tunnel %q (%d checks), stopping it",
+		am.tunnelName, am.consecutiveFailures)
+	am.events.publish(ipc.Event{
+		Type:    ipc.EventAppFailure,
+		Message: fmt.Sprintf("main app not responding for tunnel %q after %d checks", am.tunnelName, am.consecutiveFailures),
+		Time:    time.Now(),
+	})
+	am.stopTunnel("app not responding")
+	am.consecutiveFailures = 0
+}
+
+func (am *AppMonitor) stopTunnel(reason string) {
+	result, err := am.tunnel.Stop(am.tunnelName)
+	if err != nil {
+		log.Printf("Error stopping tunnel %q: %v", am.tunnelName, err)
+		return
+	}
+	log.Printf("Tunnel %q stopped (%s): %+v", am.tunnelName, reason, result)
+}
+
+// monitoredTunnel bundles one tunnel's AppMonitor with the eventHub and
+// health history it feeds, mirroring how managedTunnel bundles the
+// tunnel-side equivalents in package main (tunnel/registry.go).
+type monitoredTunnel struct {
+	monitor *AppMonitor
+	events  *eventHub
+	health  *healthHistory
+}
+
+// MonitorRegistry owns the AppMonitors derived from the -config file and
+// lets them be reloaded on SIGHUP, the same way TunnelRegistry reloads the
+// tunnel binary's own config-driven state: entries newly present in the
+// config are added and started, entries no longer present are stopped and
+// removed, existing entries are left running as-is.
+type MonitorRegistry struct {
+	mu      sync.RWMutex
+	tunnel  *TunnelClient
+	tunnels map[string]*monitoredTunnel
+}
+
+// NewMonitorRegistry creates an empty registry; call Reload to populate it.
+func NewMonitorRegistry(tunnel *TunnelClient) *MonitorRegistry {
+	return &MonitorRegistry{tunnel: tunnel, tunnels: make(map[string]*monitoredTunnel)}
+}
+
+// Reload applies a freshly-read config, starting an AppMonitor for every
+// tunnel that has a ping_url and doesn't already have one, and stopping any
+// AppMonitor whose tunnel either disappeared from the config or lost its
+// ping_url.
+func (mr *MonitorRegistry) Reload(cfg *ipc.Config) {
+	mr.mu.Lock()
+
+	seen := make(map[string]struct{}, len(cfg.Tunnels))
+	var toStart []*monitoredTunnel
+
+	for _, t := range cfg.Tunnels {
+		if t.PingURL == "" {
+			continue
+		}
+		seen[t.Name] = struct{}{}
+
+		if _, exists := mr.tunnels[t.Name]; exists {
+			continue
+		}
+
+		mt := &monitoredTunnel{events: newEventHub()}
+		mt.monitor = NewAppMonitor(mr.tunnel, mt.events, t.Name, t.PingURL, APP_CHECK_INTERVAL)
+		mt.health = mt.monitor.health
+		mr.tunnels[t.Name] = mt
+		toStart = append(toStart, mt)
+	}
+
+	var removed []*monitoredTunnel
+	for name, mt := range mr.tunnels {
+		if _, ok := seen[name]; !ok {
+			removed = append(removed, mt)
+			delete(mr.tunnels, name)
+		}
+	}
+
+	mr.mu.Unlock()
+
+	for _, mt := range toStart {
+		mt.monitor.Start()
+	}
+	for _, mt := range removed {
+		mt.monitor.Stop()
+	}
+}
+
+func (mr *MonitorRegistry) get(name string) (*monitoredTunnel, bool) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	mt, ok := mr.tunnels[name]
+	return mt, ok
+}
+
+// EventsFor returns the named tunnel's eventHub, if it has an AppMonitor.
+func (mr *MonitorRegistry) EventsFor(name string) (*eventHub, bool) {
+	mt, ok := mr.get(name)
+	if !ok {
+		return nil, false
+	}
+	return mt.events, true
+}
+
+// HealthFor returns the named tunnel's health history, if it has an
+// AppMonitor.
+func (mr *MonitorRegistry) HealthFor(name string) (*healthHistory, bool) {
+	mt, ok := mr.get(name)
+	if !ok {
+		return nil, false
+	}
+	return mt.health, true
+}
+
+// StopAll stops every AppMonitor, used on shutdown.
+func (mr *MonitorRegistry) StopAll() {
+	mr.mu.RLock()
+	tunnels := make([]*monitoredTunnel, 0, len(mr.tunnels))
+	for _, mt := range mr.tunnels {
+		tunnels = append(tunnels, mt)
+	}
+	mr.mu.RUnlock()
+
+	for _, mt := range tunnels {
+		mt.monitor.Stop()
+	}
+}
+
+// HTTPHandler handles HTTP control requests.
+type HTTPHandler struct {
+	tunnel   *TunnelClient
+	monitors *MonitorRegistry
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// The manager only ever serves the local main app on 127.0.0.1; it has
+	// no browser-facing origin to check.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// ServeHTTP handles incoming HTTP requests.
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if name, action, ok := parseTunnelPath(r.URL.Path); ok {
+		h.serveTunnelAction(w, r, name, action)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/tunnels":
+		h.serveListTunnels(w, r)
+
+	case "/start":
+		h.serveStart(w, r, defaultTunnelName)
+
+	case "/stop":
+		h.serveStop(w, r, defaultTunnelName)
+
+	case "/status":
+		h.serveStatus(w, r, defaultTunnelName)
+
+	case "/ping":
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"status": "ok",
+		})
+
+	case "/logs":
+		h.serveLogs(w, r, defaultTunnelName)
+
+	case "/events":
+		h.serveEvents(w, r, defaultTunnelName)
+
+	default:
+		respondJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": "Not found",
+		})
+	}
+}
+
+// parseTunnelPath matches "/tunnels/{name}/{action}" and returns the tunnel
+// name and action (everything after the name, unchecked; serveTunnelAction
+// accepts "start", "stop", "status", "logs" and "events").
+func parseTunnelPath(path string) (name, action string, ok bool) {
+	rest := strings.TrimPrefix(path, "/tunnels/")
+	if rest == path {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
+
+func (h *HTTPHandler) serveTunnelAction(w http.ResponseWriter, r *http.Request, name, action string) {
+	switch action {
+	case "start":
+		h.serveStart(w, r, name)
+	case "stop":
+		h.serveStop(w, r, name)
+	case "status":
+		h.serveStatus(w, r, name)
+	case "logs":
+		h.serveLogs(w, r, name)
+	case "events":
+		h.serveEvents(w, r, name)
+	default:
+		respondJSON(w, http.StatusNotFound, map[string]interface{}{"error": "Not found"})
+	}
+}
+
+func (h *HTTPHandler) serveListTunnels(w http.ResponseWriter, r *http.Request) {
+	result, err := h.tunnel.List()
+	if err != nil {
+		respondJSON(w, http.StatusBadGateway, map[string]interface{}{
+			"error": fmt.Sprintf("tunnel unreachable: %v", err),
+		})
+		return
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+func (h *HTTPHandler) serveStart(w http.ResponseWriter, r *http.Request, name string) {
+	result, err := h.tunnel.Start(name)
+	if err != nil {
+		respondJSON(w, http.StatusBadGateway, map[string]interface{}{
+			"error": fmt.Sprintf("tunnel unreachable: %v", err),
+		})
+		return
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+func (h *HTTPHandler) serveStop(w http.ResponseWriter, r *http.Request, name string) {
+	result, err := h.tunnel.Stop(name)
+	if err != nil {
+		respondJSON(w, http.StatusBadGateway, map[string]interface{}{
+			"error": fmt.Sprintf("tunnel unreachable: %v", err),
+		})
+		return
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+// statusWithHealth augments a tunnel's IPC status with the manager's own
+// view of the app's liveness, which the tunnel binary has no way to know.
+type statusWithHealth struct {
+	ipc.StatusResponse
+	Health *HealthSnapshot `json:"health,omitempty"`
+}
+
+func (h *HTTPHandler) serveStatus(w http.ResponseWriter, r *http.Request, name string) {
+	result, err := h.tunnel.Status(name)
+	if err != nil {
+		respondJSON(w, http.StatusBadGateway, map[string]interface{}{
+			"error": fmt.Sprintf("tunnel unreachable: %v", err),
+		})
+		return
+	}
+
+	out := statusWithHealth{StatusResponse: result}
+	if hh, ok := h.monitors.HealthFor(name); ok {
+		snapshot := hh.snapshot()
+		out.Health = &snapshot
+	}
+	respondJSON(w, http.StatusOK, out)
+}
+
+// doneSignal is a close-once cancellation signal shared between a
+// WebSocket's writer goroutine and the poller(s) feeding it, so whichever
+// side notices the connection is dead first can stop the others.
+type doneSignal struct {
+	once sync.Once
+	c    chan struct{}
+}
+
+func newDoneSignal() *doneSignal {
+	return &doneSignal{c: make(chan struct{})}
+}
+
+func (d *doneSignal) stop()              { d.once.Do(func() { close(d.c) }) }
+func (d *doneSignal) C() <-chan struct{} { return d.c }
+
+// serveLogs upgrades to a WebSocket and streams the named tunnel's sing-box
+// stdout/stderr lines, tailing its ring buffer via SubscribeLogs.
+func (h *HTTPHandler) serveLogs(w http.ResponseWriter, r *http.Request, name string) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("logs: websocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	outbox := make(chan interface{}, outboxSize)
+	done := newDoneSignal()
+	defer done.stop()
+	go writeOutbox(conn, outbox, done)
+
+	var cursor int64
+	for {
+		select {
+		case <-done.C():
+			return
+		default:
+		}
+
+		resp, err := h.tunnel.SubscribeLogs(name, cursor)
+		if err != nil {
+			log.Printf("logs: tunnel unreachable: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		cursor = resp.NextCursor
+
+		for _, line := range resp.Lines {
+			select {
+			case outbox <- line:
+			case <-done.C():
+				return
+			}
+		}
+	}
+}
+
+// serveEvents upgrades to a WebSocket and streams both the named tunnel's
+// state-change events (polled from the tunnel over IPC) and its own locally
+// observed AppMonitor failures/reconnects (from its eventHub, if it has
+// one), so a UI doesn't need to poll /status.
+func (h *HTTPHandler) serveEvents(w http.ResponseWriter, r *http.Request, name string) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("events: websocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	outbox := make(chan interface{}, outboxSize)
+	done := newDoneSignal()
+	defer done.stop()
+	go writeOutbox(conn, outbox, done)
+
+	if hub, ok := h.monitors.EventsFor(name); ok {
+		local := hub.subscribe()
+		defer hub.unsubscribe(local)
+
+		go func() {
+			for {
+				select {
+				case evt, ok := <-local:
+					if !ok {
+						return
+					}
+					select {
+					case outbox <- evt:
+					case <-done.C():
+						return
+					}
+				case <-done.C():
+					return
+				}
+			}
+		}()
+	}
+
+	var cursor int64
+	for {
+		select {
+		case <-done.C():
+			return
+		default:
+		}
+
+		resp, err := h.tunnel.SubscribeEvents(name, cursor)
+		if err != nil {
+			log.Printf("events: tunnel unreachable: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		cursor = resp.NextCursor
+
+		for _, evt := range resp.Events {
+			select {
+			case outbox <- evt:
+			case <-done.C():
+				return
+			}
+		}
+	}
+}
+
+// writeOutbox drains outbox to conn as JSON text frames until the
+// connection breaks, at which point it signals done so the poller(s)
+// feeding outbox stop too.
+func writeOutbox(conn *websocket.Conn, outbox chan interface{}, done *doneSignal) {
+	defer done.stop()
+
+	for {
+		select {
+		case msg := <-outbox:
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-done.C():
+			return
+		}
+	}
+}
+
+// respondJSON sends a JSON response.
+func respondJSON(w http.ResponseWriter, code int, data interface{}) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(data)
+}
+
+func main() {
+	configPath := flag.String("config", "", "path to the tunnels config file (YAML or JSON), used to discover tunnel names and their ping_url for app monitoring")
+	flag.Parse()
+
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	log.Println("RocketMan Manager starting...")
+
+	tunnel := &TunnelClient{}
+	monitors := NewMonitorRegistry(tunnel)
+
+	var configReader *ipc.ConfigReader
+	if *configPath != "" {
+		configReader = ipc.NewConfigReader(*configPath)
+		cfg, _, err := configReader.ReadIfChanged()
+		if err != nil {
+			log.Fatalf("load config: %v", err)
+		}
+		monitors.Reload(cfg)
+	}
+
+	handler := &HTTPHandler{tunnel: tunnel, monitors: monitors}
+	server := &http.Server{
+		Addr:    fmt.Sprintf("127.0.0.1:%d", HTTP_PORT),
+		Handler: handler,
+	}
+
+	go func() {
+		log.Printf("HTTP server listening on port %d", HTTP_PORT)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("HTTP server error: %v", err)
+		}
+	}()
+
+	if configReader != nil {
+		hupChan := make(chan os.Signal, 1)
+		signal.Notify(hupChan, syscall.SIGHUP)
+		go func() {
+			for range hupChan {
+				log.Println("SIGHUP received, checking config for changes")
+				cfg, changed, err := configReader.ReadIfChanged()
+				if err != nil {
+					log.Printf("reload config: %v", err)
+					continue
+				}
+				if !changed {
+					log.Println("config unchanged")
+					continue
+				}
+				monitors.Reload(cfg)
+			}
+		}()
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	<-sigChan
+	log.Println("Shutdown signal received, stopping service...")
+
+	monitors.StopAll()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown error: %v", err)
+	}
+
+	log.Println("Service stopped")
+}
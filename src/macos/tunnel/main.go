@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/RocketMan-System/rocketman-service/src/macos/ipc"
+)
+
+const maxEventBacklog = 256
+const maxLogBacklog = 1000
+
+// Supervisor defaults, modeled on supervisord: a process that dies within
+// StartSeconds of its first launch is considered fatal rather than flapping
+// forever; later exits get retried with exponential backoff up to
+// StartRetries times before giving up.
+const (
+	DefaultStartSeconds = 3 * time.Second
+	DefaultStartRetries = 3
+	backoffBase         = 1 * time.Second
+	backoffCap          = 30 * time.Second
+)
+
+// TunnelManager manages one configured sing-box instance, supervising it
+// like supervisord: start -> running -> backoff -> fatal.
+type TunnelManager struct {
+	mu          sync.Mutex
+	process     *os.Process
+	waitDone    chan struct{} // closed by superviseProcess once it has reaped the current process
+	name        string
+	singboxPath string
+	configPath  string
+
+	state        ipc.State
+	stopC        chan struct{}
+	restarts     int
+	lastExitCode int
+	lastExitTime time.Time
+
+	startSeconds time.Duration
+	startRetries int
+
+	events *eventLog
+	logs   *logRing
+}
+
+// NewTunnelManager creates a manager for the given config entry.
+func NewTunnelManager(cfg ipc.TunnelConfig, events *eventLog, logs *logRing) *TunnelManager {
+	startRetries := cfg.StartRetries
+	if startRetries <= 0 {
+		startRetries = DefaultStartRetries
+	}
+
+	return &TunnelManager{
+		name:         cfg.Name,
+		singboxPath:  cfg.SingboxPath,
+		configPath:   cfg.ConfigPath,
+		state:        ipc.StateStopped,
+		startSeconds: DefaultStartSeconds,
+		startRetries: startRetries,
+		events:       events,
+		logs:         logs,
+	}
+}
+
+// Start launches the supervised sing-box process. The first attempt runs
+// synchronously so the caller gets an immediate success/error result;
+// subsequent restarts happen in the background per the backoff policy.
+func (tm *TunnelManager) Start() ipc.StartResponse {
+	tm.mu.Lock()
+
+	switch tm.state {
+	case ipc.StateStarting, ipc.StateRunning, ipc.StateBackoff:
+		resp := ipc.StartResponse{Name: tm.name, Status: "already_running"}
+		if tm.process != nil {
+			resp.PID = tm.process.Pid
+		}
+		tm.mu.Unlock()
+		return resp
+	}
+
+	// Check if files exist
+	if _, err := os.Stat(tm.singboxPath); os.IsNotExist(err) {
+		tm.mu.Unlock()
+		return ipc.StartResponse{
+			Name:    tm.name,
+			Status:  "error",
+			Message: fmt.Sprintf("sing-box not found: %s", tm.singboxPath),
+		}
+	}
+
+	if _, err := os.Stat(tm.configPath); os.IsNotExist(err) {
+		tm.mu.Unlock()
+		return ipc.StartResponse{
+			Name:    tm.name,
+			Status:  "error",
+			Message: fmt.Sprintf("Config not found: %s", tm.configPath),
+		}
+	}
+
+	tm.stopC = make(chan struct{})
+	tm.restarts = 0
+	tm.mu.Unlock()
+
+	return tm.attemptStart(true, 0)
+}
+
+// attemptStart spawns the sing-box process and, if it survives the initial
+// startup check, hands it off to superviseProcess to watch for exit.
+// firstAttempt gates the StartSeconds "died immediately -> Fatal" rule;
+// backoffAttempt is how many backoff retries have already been consumed.
+func (tm *TunnelManager) attemptStart(firstAttempt bool, backoffAttempt int) ipc.StartResponse {
+	tm.mu.Lock()
+	tm.state = ipc.StateStarting
+	singboxPath, configPath := tm.singboxPath, tm.configPath
+	tm.mu.Unlock()
+
+	cmd := exec.Command(singboxPath, "run", "-c", configPath)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true, // Create new process group
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		tm.mu.Lock()
+		tm.state = ipc.StateFatal
+		tm.mu.Unlock()
+		return ipc.StartResponse{Name: tm.name, Status: "error", Message: fmt.Sprintf("stdout pipe: %v", err)}
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		tm.mu.Lock()
+		tm.state = ipc.StateFatal
+		tm.mu.Unlock()
+		return ipc.StartResponse{Name: tm.name, Status: "error", Message: fmt.Sprintf("stderr pipe: %v", err)}
+	}
+
+	if err := cmd.Start(); err != nil {
+		tm.mu.Lock()
+		tm.state = ipc.StateFatal
+		tm.mu.Unlock()
+		tm.events.publish(ipc.EventStateChanged, fmt.Sprintf("failed to start process: %v", err))
+		return ipc.StartResponse{
+			Name:    tm.name,
+			Status:  "error",
+			Message: fmt.Sprintf("Failed to start process: %v", err),
+		}
+	}
+
+	process := cmd.Process
+	startedAt := time.Now()
+
+	go tm.scanLines(stdout, "stdout")
+	go tm.scanLines(stderr, "stderr")
+
+	// Give process time to start
+	time.Sleep(500 * time.Millisecond)
+
+	if err := process.Signal(syscall.Signal(0)); err != nil {
+		tm.mu.Lock()
+		tm.state = ipc.StateFatal
+		tm.mu.Unlock()
+		tm.events.publish(ipc.EventStateChanged, "process exited immediately")
+		return ipc.StartResponse{
+			Name:    tm.name,
+			Status:  "error",
+			Message: "Process exited immediately",
+		}
+	}
+
+	waitDone := make(chan struct{})
+
+	tm.mu.Lock()
+	tm.process = process
+	tm.waitDone = waitDone
+	tm.state = ipc.StateRunning
+	tm.mu.Unlock()
+
+	log.Printf("Tunnel %q started: PID=%d, singbox=%s, config=%s", tm.name, process.Pid, singboxPath, configPath)
+	tm.events.publish(ipc.EventStateChanged, "tunnel running")
+
+	go tm.superviseProcess(process, startedAt, firstAttempt, backoffAttempt, waitDone)
+
+	return ipc.StartResponse{
+		Name:        tm.name,
+		Status:      "started",
+		PID:         process.Pid,
+		SingboxPath: singboxPath,
+		ConfigPath:  configPath,
+	}
+}
+
+// superviseProcess waits for the process to exit and decides whether to
+// retry with backoff, declare it Fatal, or leave it Stopped (if Stop() was
+// the one that killed it).
+func (tm *TunnelManager) superviseProcess(process *os.Process, startedAt time.Time, firstAttempt bool, backoffAttempt int, waitDone chan struct{}) {
+	state, err := process.Wait()
+	close(waitDone)
+	ranFor := time.Since(startedAt)
+
+	tm.mu.Lock()
+	stopC := tm.stopC
+	tm.lastExitCode = exitCode(state, err)
+	tm.lastExitTime = time.Now()
+
+	select {
+	case <-stopC:
+		// Stop() already closed stopC and is handling cleanup.
+		tm.mu.Unlock()
+		return
+	default:
+	}
+
+	if firstAttempt && ranFor < tm.startSeconds {
+		tm.state = ipc.StateFatal
+		tm.process = nil
+		tm.mu.Unlock()
+		log.Printf("Tunnel %q exited after %s on first attempt (< StartSeconds), giving up", tm.name, ranFor)
+		tm.events.publish(ipc.EventStateChanged, "tunnel fatal: exited before StartSeconds elapsed")
+		return
+	}
+
+	if backoffAttempt >= tm.startRetries {
+		tm.state = ipc.StateFatal
+		tm.process = nil
+		tm.mu.Unlock()
+		log.Printf("Tunnel %q exited, exhausted %d retries, giving up", tm.name, tm.startRetries)
+		tm.events.publish(ipc.EventStateChanged, "tunnel fatal: exhausted retries")
+		return
+	}
+
+	tm.state = ipc.StateBackoff
+	tm.process = nil
+	tm.restarts++
+	backoffAttempt++
+	delay := backoffDelay(backoffAttempt)
+	tm.mu.Unlock()
+
+	log.Printf("Tunnel %q exited, retrying in %s (attempt %d/%d)", tm.name, delay, backoffAttempt, tm.startRetries)
+	tm.events.publish(ipc.EventStateChanged, fmt.Sprintf("tunnel backoff: retrying in %s", delay))
+
+	select {
+	case <-time.After(delay):
+	case <-stopC:
+		tm.mu.Lock()
+		tm.state = ipc.StateStopped
+		tm.mu.Unlock()
+		return
+	}
+
+	tm.attemptStart(false, backoffAttempt)
+}
+
+// backoffDelay returns the exponential backoff for a given retry attempt
+// (1-indexed): 1s, 2s, 4s, ... capped at backoffCap.
+func backoffDelay(attempt int) time.Duration {
+	delay := backoffBase << uint(attempt-1)
+	if delay > backoffCap || delay <= 0 {
+		return backoffCap
+	}
+	return delay
+}
+
+// exitCode extracts the process exit code from process.Wait()'s result
+// (an *exec.ExitError error, as cmd.Wait() returns, is also understood).
+func exitCode(state *os.ProcessState, err error) int {
+	if state != nil {
+		return state.ExitCode()
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// Stop stops the tunnel and cancels any pending backoff retry.
+func (tm *TunnelManager) Stop() ipc.StopResponse {
+	tm.mu.Lock()
+
+	if tm.state == ipc.StateStopped || tm.state == ipc.StateFatal {
+		tm.mu.Unlock()
+		return ipc.StopResponse{Name: tm.name, Status: "not_running"}
+	}
+
+	if tm.stopC != nil {
+		close(tm.stopC)
+	}
+	process := tm.process
+	waitDone := tm.waitDone
+	tm.mu.Unlock()
+
+	if process == nil {
+		// Nothing running yet (e.g. mid-backoff); the supervise goroutine
+		// will see stopC closed and settle into Stopped on its own.
+		tm.mu.Lock()
+		tm.state = ipc.StateStopped
+		tm.mu.Unlock()
+		log.Println("Tunnel stopped")
+		tm.events.publish(ipc.EventStateChanged, "tunnel stopped")
+		return ipc.StopResponse{Name: tm.name, Status: "stopped"}
+	}
+
+	// Send SIGTERM
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		log.Printf("Error sending SIGTERM: %v", err)
+	}
+
+	// Wait for the process to exit (with timeout). superviseProcess owns
+	// the only call to process.Wait() for this process; calling Wait()
+	// again here would race it for the exit status, so we just wait for
+	// waitDone instead.
+	select {
+	case <-waitDone:
+		// Process exited gracefully
+	case <-time.After(5 * time.Second):
+		// Timeout - force kill
+		log.Println("Process didn't exit gracefully, sending SIGKILL")
+		process.Signal(syscall.SIGKILL)
+		<-waitDone
+	}
+
+	tm.mu.Lock()
+	tm.process = nil
+	tm.state = ipc.StateStopped
+	tm.mu.Unlock()
+
+	log.Println("Tunnel stopped")
+	tm.events.publish(ipc.EventStateChanged, "tunnel stopped")
+
+	return ipc.StopResponse{Name: tm.name, Status: "stopped"}
+}
+
+// GetStatus returns tunnel status.
+func (tm *TunnelManager) GetStatus() ipc.StatusResponse {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	resp := ipc.StatusResponse{
+		Name:         tm.name,
+		Status:       string(tm.state),
+		State:        tm.state,
+		SingboxPath:  tm.singboxPath,
+		ConfigPath:   tm.configPath,
+		LastExitCode: tm.lastExitCode,
+		LastExitTime: tm.lastExitTime,
+		Restarts:     tm.restarts,
+	}
+	if tm.process != nil {
+		resp.PID = tm.process.Pid
+	}
+	return resp
+}
+
+// scanLines reads lines from a sing-box stdout/stderr pipe and pushes them
+// into the log ring. It returns once the pipe is closed (the process exited
+// or was killed).
+func (tm *TunnelManager) scanLines(r io.Reader, stream string) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		tm.logs.publish(stream, scanner.Text())
+	}
+}
+
+// logRing is a ring-buffered, cursor-addressable backlog of the last
+// maxLogBacklog sing-box output lines, used to back the blocking
+// SubscribeLogs RPC the same way eventLog backs SubscribeEvents.
+type logRing struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	lines  []ipc.LogLine
+	cursor int64
+}
+
+func newLogRing() *logRing {
+	lr := &logRing{}
+	lr.cond = sync.NewCond(&lr.mu)
+	return lr
+}
+
+func (lr *logRing) publish(stream, text string) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	lr.cursor++
+	lr.lines = append(lr.lines, ipc.LogLine{Stream: stream, Text: text, Time: time.Now()})
+	if len(lr.lines) > maxLogBacklog {
+		lr.lines = lr.lines[len(lr.lines)-maxLogBacklog:]
+	}
+	lr.cond.Broadcast()
+}
+
+// since returns log lines published after cursor, blocking until at least
+// one is available or timeout elapses.
+func (lr *logRing) since(cursor int64, timeout time.Duration) ([]ipc.LogLine, int64) {
+	deadline := time.Now().Add(timeout)
+
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	for lr.cursor <= cursor {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, lr.cursor
+		}
+
+		timer := time.AfterFunc(remaining, lr.cond.Broadcast)
+		lr.cond.Wait()
+		timer.Stop()
+	}
+
+	start := len(lr.lines) - int(lr.cursor-cursor)
+	if start < 0 {
+		start = 0
+	}
+
+	out := make([]ipc.LogLine, len(lr.lines[start:]))
+	copy(out, lr.lines[start:])
+	return out, lr.cursor
+}
+
+// eventLog is a small in-memory, cursor-addressable backlog of events used
+// to back the blocking SubscribeEvents RPC.
+type eventLog struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	events []ipc.Event
+	cursor int64
+}
+
+func newEventLog() *eventLog {
+	el := &eventLog{}
+	el.cond = sync.NewCond(&el.mu)
+	return el
+}
+
+func (el *eventLog) publish(typ ipc.EventType, message string) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	el.cursor++
+	el.events = append(el.events, ipc.Event{Type: typ, Message: message, Time: time.Now()})
+	if len(el.events) > maxEventBacklog {
+		el.events = el.events[len(el.events)-maxEventBacklog:]
+	}
+	el.cond.Broadcast()
+}
+
+// since returns events published after cursor, blocking until at least one
+// is available or timeout elapses.
+func (el *eventLog) since(cursor int64, timeout time.Duration) ([]ipc.Event, int64) {
+	deadline := time.Now().Add(timeout)
+
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	for el.cursor <= cursor {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, el.cursor
+		}
+
+		timer := time.AfterFunc(remaining, el.cond.Broadcast)
+		el.cond.Wait()
+		timer.Stop()
+	}
+
+	start := len(el.events) - int(el.cursor-cursor)
+	if start < 0 {
+		start = 0
+	}
+
+	out := make([]ipc.Event, len(el.events[start:]))
+	copy(out, el.events[start:])
+	return out, el.cursor
+}
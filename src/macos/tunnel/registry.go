@@ -0,0 +1,323 @@
+// Command tunnel is the privileged half of the RocketMan service. It owns
+// the sing-box processes and is the only thing that touches the network;
+// it never talks HTTP and is only reachable over the local Unix domain
+// socket defined in package ipc. It supervises every tunnel named in its
+// -config file and hot-reloads that file on SIGHUP.
+//
+// It also doubles as its own service installer: the install, uninstall,
+// start and stop subcommands (see service.go) register it with launchd on
+// macOS or systemd on Linux instead of running the supervisor loop.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/RocketMan-System/rocketman-service/src/macos/ipc"
+)
+
+// managedTunnel bundles a TunnelManager with the event/log rings that back
+// its SubscribeEvents/SubscribeLogs RPCs.
+type managedTunnel struct {
+	manager *TunnelManager
+	events  *eventLog
+	logs    *logRing
+}
+
+// TunnelRegistry supervises every tunnel defined in the config file. Each
+// tunnel has its own mutex (inside its TunnelManager), so an operation on
+// one tunnel never blocks operations on another.
+type TunnelRegistry struct {
+	mu      sync.RWMutex
+	tunnels map[string]*managedTunnel
+}
+
+// NewTunnelRegistry creates an empty registry; call Reload to populate it.
+func NewTunnelRegistry() *TunnelRegistry {
+	return &TunnelRegistry{tunnels: make(map[string]*managedTunnel)}
+}
+
+// Reload applies a freshly-read config: new entries are added (and
+// autostarted if configured), entries no longer present are stopped and
+// removed. Existing tunnels are left running as-is; config changes to an
+// already-known tunnel take effect the next time it's (re)started.
+func (tr *TunnelRegistry) Reload(cfg *ipc.Config) {
+	tr.mu.Lock()
+
+	seen := make(map[string]struct{}, len(cfg.Tunnels))
+	var toAutostart []*managedTunnel
+
+	for _, entry := range cfg.Tunnels {
+		seen[entry.Name] = struct{}{}
+
+		if existing, exists := tr.tunnels[entry.Name]; exists {
+			tm := existing.manager
+			tm.mu.Lock()
+			tm.singboxPath = entry.SingboxPath
+			tm.configPath = entry.ConfigPath
+			tm.startRetries = entry.StartRetries
+			if tm.startRetries <= 0 {
+				tm.startRetries = DefaultStartRetries
+			}
+			tm.mu.Unlock()
+			continue
+		}
+
+		mt := &managedTunnel{
+			events: newEventLog(),
+			logs:   newLogRing(),
+		}
+		mt.manager = NewTunnelManager(entry, mt.events, mt.logs)
+		tr.tunnels[entry.Name] = mt
+
+		if entry.Autostart {
+			toAutostart = append(toAutostart, mt)
+		}
+	}
+
+	var removed []*managedTunnel
+	for name, mt := range tr.tunnels {
+		if _, ok := seen[name]; !ok {
+			removed = append(removed, mt)
+			delete(tr.tunnels, name)
+		}
+	}
+
+	tr.mu.Unlock()
+
+	for _, mt := range toAutostart {
+		log.Printf("Autostarting tunnel %q", mt.manager.name)
+		mt.manager.Start()
+	}
+	for _, mt := range removed {
+		log.Printf("Tunnel %q removed from config, stopping", mt.manager.name)
+		mt.manager.Stop()
+	}
+}
+
+func (tr *TunnelRegistry) get(name string) (*managedTunnel, bool) {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	mt, ok := tr.tunnels[name]
+	return mt, ok
+}
+
+func (tr *TunnelRegistry) Start(name string) ipc.StartResponse {
+	mt, ok := tr.get(name)
+	if !ok {
+		return ipc.StartResponse{Name: name, Status: "error", Message: fmt.Sprintf("unknown tunnel: %s", name)}
+	}
+	return mt.manager.Start()
+}
+
+func (tr *TunnelRegistry) Stop(name string) ipc.StopResponse {
+	mt, ok := tr.get(name)
+	if !ok {
+		return ipc.StopResponse{Name: name, Status: "error"}
+	}
+	return mt.manager.Stop()
+}
+
+func (tr *TunnelRegistry) Status(name string) (ipc.StatusResponse, bool) {
+	mt, ok := tr.get(name)
+	if !ok {
+		return ipc.StatusResponse{}, false
+	}
+	return mt.manager.GetStatus(), true
+}
+
+func (tr *TunnelRegistry) List() []ipc.StatusResponse {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+
+	out := make([]ipc.StatusResponse, 0, len(tr.tunnels))
+	for _, mt := range tr.tunnels {
+		out = append(out, mt.manager.GetStatus())
+	}
+	return out
+}
+
+// StopAll stops every tunnel, used on shutdown.
+func (tr *TunnelRegistry) StopAll() {
+	tr.mu.RLock()
+	tunnels := make([]*managedTunnel, 0, len(tr.tunnels))
+	for _, mt := range tr.tunnels {
+		tunnels = append(tunnels, mt)
+	}
+	tr.mu.RUnlock()
+
+	for _, mt := range tunnels {
+		mt.manager.Stop()
+	}
+}
+
+// TunnelService exposes TunnelRegistry over net/rpc with the typed IPC
+// contract defined in package ipc.
+type TunnelService struct {
+	registry *TunnelRegistry
+}
+
+func (s *TunnelService) Start(req ipc.StartRequest, resp *ipc.StartResponse) error {
+	*resp = s.registry.Start(req.Name)
+	return nil
+}
+
+func (s *TunnelService) Stop(req ipc.StopRequest, resp *ipc.StopResponse) error {
+	*resp = s.registry.Stop(req.Name)
+	return nil
+}
+
+func (s *TunnelService) Status(req ipc.StatusRequest, resp *ipc.StatusResponse) error {
+	status, ok := s.registry.Status(req.Name)
+	if !ok {
+		return fmt.Errorf("unknown tunnel: %s", req.Name)
+	}
+	*resp = status
+	return nil
+}
+
+func (s *TunnelService) ListTunnels(req ipc.ListTunnelsRequest, resp *ipc.ListTunnelsResponse) error {
+	resp.Tunnels = s.registry.List()
+	return nil
+}
+
+func (s *TunnelService) SubscribeEvents(req ipc.SubscribeEventsRequest, resp *ipc.SubscribeEventsResponse) error {
+	mt, ok := s.registry.get(req.Name)
+	if !ok {
+		return fmt.Errorf("unknown tunnel: %s", req.Name)
+	}
+	events, cursor := mt.events.since(req.Cursor, 25*time.Second)
+	resp.Events = events
+	resp.NextCursor = cursor
+	return nil
+}
+
+func (s *TunnelService) SubscribeLogs(req ipc.SubscribeLogsRequest, resp *ipc.SubscribeLogsResponse) error {
+	mt, ok := s.registry.get(req.Name)
+	if !ok {
+		return fmt.Errorf("unknown tunnel: %s", req.Name)
+	}
+	lines, cursor := mt.logs.since(req.Cursor, 25*time.Second)
+	resp.Lines = lines
+	resp.NextCursor = cursor
+	return nil
+}
+
+func main() {
+	if len(os.Args) > 1 && serviceCommands[os.Args[1]] {
+		if err := runServiceCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("%s: %v", os.Args[1], err)
+		}
+		return
+	}
+
+	configPath := flag.String("config", "", "path to the tunnels config file (YAML or JSON)")
+	allowUID := flag.Int("allow-uid", -1, "only authorize manager connections from this UID (-1 disables the check, for local testing)")
+	flag.Parse()
+
+	if *configPath == "" {
+		log.Fatal("-config is required")
+	}
+
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	log.Println("RocketMan Tunnel starting...")
+
+	registry := NewTunnelRegistry()
+	configReader := ipc.NewConfigReader(*configPath)
+
+	cfg, _, err := configReader.ReadIfChanged()
+	if err != nil {
+		log.Fatalf("load config: %v", err)
+	}
+	registry.Reload(cfg)
+
+	os.Remove(ipc.SocketPath)
+
+	listener, err := net.Listen("unix", ipc.SocketPath)
+	if err != nil {
+		log.Fatalf("listen on %s: %v", ipc.SocketPath, err)
+	}
+	// The tunnel runs as root, so a 0600 socket would be unreachable to the
+	// manager running as an ordinary user: connect() on a root-owned,
+	// owner-only socket is rejected before PeerUID ever gets a say. Leave
+	// the socket world-connectable and let allowUID/PeerUID do the actual
+	// authorization per-connection, in acceptLoop below.
+	if err := os.Chmod(ipc.SocketPath, 0666); err != nil {
+		log.Fatalf("chmod socket: %v", err)
+	}
+	defer listener.Close()
+
+	rpcServer := rpc.NewServer()
+	if err := rpcServer.RegisterName(ipc.ServiceName, &TunnelService{registry: registry}); err != nil {
+		log.Fatalf("register RPC service: %v", err)
+	}
+
+	go acceptLoop(listener, rpcServer, *allowUID)
+
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			log.Println("SIGHUP received, checking config for changes")
+			cfg, changed, err := configReader.ReadIfChanged()
+			if err != nil {
+				log.Printf("reload config: %v", err)
+				continue
+			}
+			if !changed {
+				log.Println("config unchanged")
+				continue
+			}
+			registry.Reload(cfg)
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+
+	log.Println("Shutdown signal received, stopping all tunnels...")
+	registry.StopAll()
+	log.Println("Tunnel service stopped")
+}
+
+func acceptLoop(listener net.Listener, rpcServer *rpc.Server, allowUID int) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("accept error: %v", err)
+			return
+		}
+
+		unixConn, ok := conn.(*net.UnixConn)
+		if !ok {
+			log.Println("rejecting non-Unix connection")
+			conn.Close()
+			continue
+		}
+
+		if allowUID >= 0 {
+			uid, err := ipc.PeerUID(unixConn)
+			if err != nil {
+				log.Printf("rejecting connection, peer uid check failed: %v", err)
+				conn.Close()
+				continue
+			}
+			if uid != uint32(allowUID) {
+				log.Printf("rejecting connection from unauthorized uid %d", uid)
+				conn.Close()
+				continue
+			}
+		}
+
+		go rpcServer.ServeConn(conn)
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// serviceCommands are the tunnel subcommands that manage its own OS service
+// registration, as opposed to running the supervisor loop directly.
+var serviceCommands = map[string]bool{
+	"install":   true,
+	"uninstall": true,
+	"start":     true,
+	"stop":      true,
+}
+
+const (
+	launchdLabel     = "com.rocketman.tunnel"
+	launchdPlistPath = "/Library/LaunchDaemons/" + launchdLabel + ".plist"
+
+	systemdUnitName = "rocketman-tunnel.service"
+	systemdUnitPath = "/etc/systemd/system/" + systemdUnitName
+
+	serviceLogDir = "/var/log/rocketman"
+)
+
+// runServiceCommand dispatches an install/uninstall/start/stop subcommand,
+// re-executing with elevated privileges first if we're not already root.
+func runServiceCommand(cmd string, args []string) error {
+	if cmd == "install" {
+		args = ensureAllowUIDArg(args)
+	}
+
+	if os.Geteuid() != 0 {
+		return reExecWithPrivileges(cmd, args)
+	}
+
+	switch cmd {
+	case "install":
+		fs := flag.NewFlagSet("install", flag.ExitOnError)
+		configPath := fs.String("config", "", "path to the tunnels config file (YAML or JSON) the service should run with")
+		allowUID := fs.Int("allow-uid", -1, "uid the manager will connect as; only this uid is authorized on the tunnel socket")
+		fs.Parse(args)
+
+		if *configPath == "" {
+			return fmt.Errorf("-config is required")
+		}
+		if *allowUID < 0 {
+			return fmt.Errorf("-allow-uid is required (the uid the manager will run as)")
+		}
+		absConfig, err := filepath.Abs(*configPath)
+		if err != nil {
+			return fmt.Errorf("resolve config path: %w", err)
+		}
+		return installService(absConfig, *allowUID)
+
+	case "uninstall":
+		return uninstallService()
+
+	case "start":
+		return startService()
+
+	case "stop":
+		return stopService()
+
+	default:
+		return fmt.Errorf("unknown service command: %s", cmd)
+	}
+}
+
+// ensureAllowUIDArg fills in -allow-uid for the install subcommand when the
+// caller didn't pass one explicitly, so the service we install always ends
+// up with peer-uid authorization enabled instead of silently defaulting to
+// -1 (disabled). It's derived from whoever is actually running `install`:
+// our own uid if we haven't elevated yet (the common case, since we append
+// it before re-exec'ing via osascript/pkexec below), or SUDO_UID/PKEXEC_UID
+// if we were already invoked as root through one of those.
+func ensureAllowUIDArg(args []string) []string {
+	for _, a := range args {
+		if a == "-allow-uid" || a == "--allow-uid" ||
+			strings.HasPrefix(a, "-allow-uid=") || strings.HasPrefix(a, "--allow-uid=") {
+			return args
+		}
+	}
+
+	if uid := os.Getuid(); uid != 0 {
+		return append(args, "-allow-uid", strconv.Itoa(uid))
+	}
+	if sudoUID := os.Getenv("SUDO_UID"); sudoUID != "" {
+		return append(args, "-allow-uid", sudoUID)
+	}
+	if pkexecUID := os.Getenv("PKEXEC_UID"); pkexecUID != "" {
+		return append(args, "-allow-uid", pkexecUID)
+	}
+
+	return args
+}
+
+func installService(configPath string, allowUID int) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return installLaunchd(configPath, allowUID)
+	case "linux":
+		return installSystemd(configPath, allowUID)
+	default:
+		return fmt.Errorf("service installation is not supported on %s", runtime.GOOS)
+	}
+}
+
+func uninstallService() error {
+	switch runtime.GOOS {
+	case "darwin":
+		return uninstallLaunchd()
+	case "linux":
+		return uninstallSystemd()
+	default:
+		return fmt.Errorf("service installation is not supported on %s", runtime.GOOS)
+	}
+}
+
+func startService() error {
+	switch runtime.GOOS {
+	case "darwin":
+		return startLaunchd()
+	case "linux":
+		return startSystemd()
+	default:
+		return fmt.Errorf("service installation is not supported on %s", runtime.GOOS)
+	}
+}
+
+func stopService() error {
+	switch runtime.GOOS {
+	case "darwin":
+		return stopLaunchd()
+	case "linux":
+		return stopSystemd()
+	default:
+		return fmt.Errorf("service installation is not supported on %s", runtime.GOOS)
+	}
+}
+
+// launchdPlistTemplate mirrors how wireguard-windows' manager/install.go
+// self-registers as a service, translated to launchd's plist format:
+// RunAtLoad so it comes up at boot, KeepAlive.SuccessfulExit=false so
+// launchd only restarts it after a crash (not a clean exit from stop),
+// and separate stdout/stderr log files.
+const launchdPlistTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>%s</string>
+		<string>-config</string>
+		<string>%s</string>
+		<string>-allow-uid</string>
+		<string>%d</string>
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>StandardOutPath</key>
+	<string>%s/tunnel.log</string>
+	<key>StandardErrorPath</key>
+	<string>%s/tunnel.err.log</string>
+</dict>
+</plist>
+`
+
+func installLaunchd(configPath string, allowUID int) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locate executable: %w", err)
+	}
+
+	if err := os.MkdirAll(serviceLogDir, 0755); err != nil {
+		return fmt.Errorf("create log dir: %w", err)
+	}
+
+	plist := fmt.Sprintf(launchdPlistTemplate, launchdLabel, exe, configPath, allowUID, serviceLogDir, serviceLogDir)
+	if err := os.WriteFile(launchdPlistPath, []byte(plist), 0644); err != nil {
+		return fmt.Errorf("write plist: %w", err)
+	}
+
+	if err := exec.Command("launchctl", "bootstrap", "system", launchdPlistPath).Run(); err != nil {
+		log.Printf("launchctl bootstrap failed (%v), falling back to launchctl load -w", err)
+		if err := exec.Command("launchctl", "load", "-w", launchdPlistPath).Run(); err != nil {
+			return fmt.Errorf("launchctl load: %w", err)
+		}
+	}
+
+	log.Printf("Installed launchd service %s", launchdLabel)
+	return nil
+}
+
+func uninstallLaunchd() error {
+	if err := exec.Command("launchctl", "bootout", "system/"+launchdLabel).Run(); err != nil {
+		log.Printf("launchctl bootout failed (%v), falling back to launchctl unload", err)
+		if err := exec.Command("launchctl", "unload", launchdPlistPath).Run(); err != nil {
+			log.Printf("launchctl unload also failed: %v", err)
+		}
+	}
+
+	if err := os.Remove(launchdPlistPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove plist: %w", err)
+	}
+
+	log.Printf("Uninstalled launchd service %s", launchdLabel)
+	return nil
+}
+
+func startLaunchd() error {
+	return exec.Command("launchctl", "kickstart", "-k", "system/"+launchdLabel).Run()
+}
+
+func stopLaunchd() error {
+	return exec.Command("launchctl", "stop", launchdLabel).Run()
+}
+
+const systemdUnitTemplate = `[Unit]
+Description=RocketMan Tunnel
+After=network.target
+
+[Service]
+ExecStart=%s -config %s -allow-uid %d
+Restart=on-failure
+StandardOutput=append:%s/tunnel.log
+StandardError=append:%s/tunnel.err.log
+
+[Install]
+WantedBy=multi-user.target
+`
+
+func installSystemd(configPath string, allowUID int) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locate executable: %w", err)
+	}
+
+	if err := os.MkdirAll(serviceLogDir, 0755); err != nil {
+		return fmt.Errorf("create log dir: %w", err)
+	}
+
+	unit := fmt.Sprintf(systemdUnitTemplate, exe, configPath, allowUID, serviceLogDir, serviceLogDir)
+	if err := os.WriteFile(systemdUnitPath, []byte(unit), 0644); err != nil {
+		return fmt.Errorf("write unit file: %w", err)
+	}
+
+	if err := exec.Command("systemctl", "daemon-reload").Run(); err != nil {
+		return fmt.Errorf("systemctl daemon-reload: %w", err)
+	}
+	if err := exec.Command("systemctl", "enable", "--now", systemdUnitName).Run(); err != nil {
+		return fmt.Errorf("systemctl enable: %w", err)
+	}
+
+	log.Printf("Installed systemd service %s", systemdUnitName)
+	return nil
+}
+
+func uninstallSystemd() error {
+	if err := exec.Command("systemctl", "disable", "--now", systemdUnitName).Run(); err != nil {
+		log.Printf("systemctl disable failed: %v", err)
+	}
+
+	if err := os.Remove(systemdUnitPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove unit file: %w", err)
+	}
+
+	if err := exec.Command("systemctl", "daemon-reload").Run(); err != nil {
+		log.Printf("systemctl daemon-reload failed: %v", err)
+	}
+
+	log.Printf("Uninstalled systemd service %s", systemdUnitName)
+	return nil
+}
+
+func startSystemd() error {
+	return exec.Command("systemctl", "start", systemdUnitName).Run()
+}
+
+func stopSystemd() error {
+	return exec.Command("systemctl", "stop", systemdUnitName).Run()
+}
+
+// reExecWithPrivileges re-runs the current executable with cmd and args,
+// elevated to root: via osascript's administrator-privileges prompt on
+// macOS, or pkexec on Linux.
+func reExecWithPrivileges(cmd string, args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locate executable: %w", err)
+	}
+
+	fullArgs := append([]string{cmd}, args...)
+
+	switch runtime.GOOS {
+	case "darwin":
+		return runWithOsascript(exe, fullArgs)
+	case "linux":
+		return runWithPkexec(exe, fullArgs)
+	default:
+		return fmt.Errorf("%s must be run as root on %s", cmd, runtime.GOOS)
+	}
+}
+
+func runWithOsascript(exe string, args []string) error {
+	parts := make([]string, 0, len(args)+1)
+	parts = append(parts, shellQuote(exe))
+	for _, a := range args {
+		parts = append(parts, shellQuote(a))
+	}
+	shellCmd := strings.Join(parts, " ")
+	script := fmt.Sprintf("do shell script %s with administrator privileges", appleScriptQuote(shellCmd))
+
+	run := exec.Command("osascript", "-e", script)
+	run.Stdout = os.Stdout
+	run.Stderr = os.Stderr
+	return run.Run()
+}
+
+func runWithPkexec(exe string, args []string) error {
+	run := exec.Command("pkexec", append([]string{exe}, args...)...)
+	run.Stdin = os.Stdin
+	run.Stdout = os.Stdout
+	run.Stderr = os.Stderr
+	return run.Run()
+}
+
+// shellQuote single-quotes s for safe use inside a POSIX shell command line.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// appleScriptQuote double-quotes s for safe use inside an AppleScript
+// string literal.
+func appleScriptQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}